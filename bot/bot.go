@@ -17,6 +17,7 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 package botlib
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"sync"
@@ -26,6 +27,7 @@ import (
 	"github.com/sabafly/gobot-lib/constants"
 	"github.com/sabafly/gobot-lib/env"
 	"github.com/sabafly/gobot-lib/logging"
+	"github.com/sabafly/gobot-lib/plugins"
 )
 
 func init() {
@@ -63,10 +65,38 @@ type BotManager struct {
 	ShardCount int
 	Shards     []*Shard
 	features   *FeatureManager
+	plugins    *plugins.Manager
+
+	// 起動後に動的に追加されるアプリケーションコマンドのハンダラ。
+	// ApplicationCommands.Parse() が返す静的なハンダラの動的版
+	commands *DynamicApplicationCommands
+
+	systemsMu sync.RWMutex
+	systems   map[string]System
+}
+
+// AddFeature などフィーチャー管理に使う FeatureManager を返す
+func (b *BotManager) Features() *FeatureManager {
+	return b.features
+}
+
+// プラグインサブシステムが有効なら *plugins.Manager を返す
+//
+// EnablePlugins を呼んでいない場合は nil
+func (b *BotManager) Plugins() *plugins.Manager {
+	return b.plugins
 }
 
 // ボットセッションを開始する
+//
+// Register で登録されたサブシステムを依存順に Init/Start してハンドラを
+// 揃えてから、シャードを接続する。ゲートウェイイベントは discordgo が
+// s.Open() の時点で配送を始めるため、ハンドラの登録をそれより先に終える
 func (b *BotManager) Open() (err error) {
+	if err := b.initSystems(); err != nil {
+		return fmt.Errorf("failed init systems: %w", err)
+	}
+
 	shards := b.Shards
 
 	for i := range shards {
@@ -92,25 +122,36 @@ func (b *BotManager) Open() (err error) {
 		}
 	}
 	b.Shards = shards
+
 	return nil
 }
 
 // ボットセッションを終了する
+//
+// まず登録済みサブシステムを依存関係の逆順に Stop し、在庫中の RequestFeatureIDRespond
+// の待受などを打ち切らせる。Stop が失敗したサブシステムがあってもシャードの
+// 切断は止めず、すべてのエラーをまとめて返す
 func (b *BotManager) Close() (err error) {
+	var errs []error
+
+	if err := b.stopSystems(); err != nil {
+		errs = append(errs, fmt.Errorf("failed stop systems: %w", err))
+	}
+
 	shards := b.Shards
 	for i := range shards {
 		s := shards[i].Session
 
 		if err := s.Close(); err != nil {
-			return fmt.Errorf("failed close session: %w", err)
+			errs = append(errs, fmt.Errorf("failed close session: %w", err))
 		}
 
 		if err := shards[i].ApiClose(); err != nil {
-			return fmt.Errorf("failed close api connection: %w", err)
+			errs = append(errs, fmt.Errorf("failed close api connection: %w", err))
 		}
 	}
 	b.Shards = shards
-	return nil
+	return errors.Join(errs...)
 }
 
 // 新規のボット接続を作成する
@@ -157,6 +198,7 @@ func validateShards(token string, count int) (bot *BotManager, err error) {
 		// API接続関連
 		Api:      NewApi(),
 		features: NewFeatureManager(),
+		commands: NewDynamicApplicationCommands(),
 	}
 
 	for i := 0; i < count; i++ {
@@ -173,6 +215,12 @@ func validateShards(token string, count int) (bot *BotManager, err error) {
 		})
 	}
 
+	// フィーチャー/コンポーネント待受/コマンドディスパッチは常に必要なため既定で登録する。
+	// persistence/plugins は接続先・ディレクトリが利用側ごとに異なるため各自 Register する
+	bot.Register(newFeaturesSystem())
+	bot.Register(newInteractionsSystem())
+	bot.Register(newCommandsSystem())
+
 	return bot, nil
 }
 
@@ -191,9 +239,28 @@ func (b *BotManager) interfaceHandler(s *discordgo.Session, i any) {
 		b.guildDeleteCall(t)
 	case *discordgo.MessageCreate:
 		b.messageCreateCall(t)
+	case *discordgo.InteractionCreate:
+		if b.plugins != nil && (t.Type == discordgo.InteractionMessageComponent || t.Type == discordgo.InteractionModalSubmit) {
+			b.plugins.DispatchInteraction(s, t)
+		}
+		b.commands.dispatch(s, t)
 	}
 }
 
+// 起動後に動的に追加されるアプリケーションコマンドのハンダラを登録する
+//
+// プラグインなど、起動時にツリーへ静的に積めないコマンドのために使う。
+// ApplicationCommands.Parse() で作る静的なツリーの代わりに
+// DynamicApplicationCommands へ委譲している
+func (b *BotManager) RegisterApplicationCommandHandler(name string, handler func(*discordgo.Session, *discordgo.InteractionCreate)) {
+	b.commands.Register(name, handler)
+}
+
+// 動的に登録されたアプリケーションコマンドのハンダラを取り外す
+func (b *BotManager) UnregisterApplicationCommandHandler(name string) {
+	b.commands.Unregister(name)
+}
+
 // 内部APIのイベントハンダラを登録する
 func (b *BotManager) AddApiHandler(handler any) {
 	for _, s := range b.Shards {
@@ -19,6 +19,7 @@ package botlib
 import (
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/sabafly/gobot-lib/env"
@@ -53,6 +54,50 @@ func (a *ApplicationCommands) Parse() func(*discordgo.Session, *discordgo.Intera
 	}
 }
 
+// Parse が返すハンダラは呼んだ時点のツリーのスナップショットで、起動後に
+// 差し替えることはできない。プラグインのように起動後にハンダラを足したり
+// 外したりしたい場合はこちらを使う
+type DynamicApplicationCommands struct {
+	mu       sync.RWMutex
+	handlers map[string]func(*discordgo.Session, *discordgo.InteractionCreate)
+}
+
+// 空の DynamicApplicationCommands を作る
+func NewDynamicApplicationCommands() *DynamicApplicationCommands {
+	return &DynamicApplicationCommands{handlers: map[string]func(*discordgo.Session, *discordgo.InteractionCreate){}}
+}
+
+// 起動後に動的にハンダラを足す
+func (d *DynamicApplicationCommands) Register(name string, handler func(*discordgo.Session, *discordgo.InteractionCreate)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers[name] = handler
+}
+
+// 動的に足したハンダラを外す
+func (d *DynamicApplicationCommands) Unregister(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.handlers, name)
+}
+
+// discordgo.Session.AddHandler にそのまま渡せるハンダラを返す
+func (d *DynamicApplicationCommands) Handler() func(*discordgo.Session, *discordgo.InteractionCreate) {
+	return d.dispatch
+}
+
+func (d *DynamicApplicationCommands) dispatch(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+	d.mu.RLock()
+	handler, ok := d.handlers[i.ApplicationCommandData().Name]
+	d.mu.RUnlock()
+	if ok {
+		handler(s, i)
+	}
+}
+
 // ボットにアプリケーションコマンドを登録する
 func (b *BotManager) ApplicationCommandCreate(tree ApplicationCommands) (registeredCommands []*discordgo.ApplicationCommand, err error) {
 	if len(b.Shards) == 0 {
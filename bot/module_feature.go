@@ -1,12 +1,17 @@
 package botlib
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/google/uuid"
+	"github.com/sabafly/gobot-lib/featuredata"
+	"github.com/sabafly/gobot-lib/interactions"
 	"github.com/sabafly/gobot-lib/logging"
 )
 
@@ -18,6 +23,36 @@ type FeatureManager struct {
 	sync.Mutex
 	featureMap                 map[FeatureType][]*Feature
 	ApplicationCommandSettings FeatureApplicationCommandSettings
+
+	router *interactions.Router
+
+	// FeatureType毎のイベントディスパッチャ。RegisterEventType で登録される
+	eventTypes sync.Map
+
+	roleCache memberRoleCache
+
+	// AddFeature で Data が未指定のときに使う既定のストア
+	store featuredata.Store
+}
+
+// NewFeatureManager の生成オプション
+type FeatureManagerOption func(*FeatureManager)
+
+// AddFeature で Data が指定されなかった Feature に既定の FeatureData を与えるストアを設定する
+func WithStore(store featuredata.Store) FeatureManagerOption {
+	return func(fm *FeatureManager) {
+		fm.store = store
+	}
+}
+
+// 生成後に既定のストアを差し替える
+//
+// PersistenceSystem のように、マイグレーションを実行してから
+// ストアを結びつけたいシステムのために WithStore とは別に公開している
+func (fm *FeatureManager) SetStore(store featuredata.Store) {
+	fm.Lock()
+	defer fm.Unlock()
+	fm.store = store
 }
 
 type FeatureApplicationCommandSettings struct {
@@ -30,15 +65,46 @@ type FeatureApplicationCommandSettings struct {
 	Type                    discordgo.ApplicationCommandType
 }
 
-func NewFeatureManager() *FeatureManager {
-	return &FeatureManager{
+// janitor がAwait中のセッションを掃除する間隔
+const featureRouterJanitorInterval = 30 * time.Second
+
+func NewFeatureManager(opts ...FeatureManagerOption) *FeatureManager {
+	fm := &FeatureManager{
 		featureMap: map[FeatureType][]*Feature{},
+		router:     interactions.NewRouter(featureRouterJanitorInterval),
+		roleCache:  memberRoleCache{roles: map[string][]string{}},
+	}
+	for _, opt := range opts {
+		opt(fm)
 	}
+	RegisterEventType(fm, FeatureMessageCreate, func(v *discordgo.MessageCreate) EventScope {
+		scope := EventScope{ChannelID: v.ChannelID, GuildID: v.GuildID}
+		if v.Member != nil && v.Member.User != nil {
+			scope.UserID = v.Member.User.ID
+		} else if v.Author != nil {
+			scope.UserID = v.Author.ID
+		}
+		return scope
+	})
+	RegisterEventType(fm, FeatureTypingStart, func(v *discordgo.TypingStart) EventScope {
+		return EventScope{ChannelID: v.ChannelID, GuildID: v.GuildID, UserID: v.UserID}
+	})
+	return fm
+}
+
+// コンポーネントインタラクションのルーティングに使う Router
+//
+// 長命なコンポーネントハンダラを登録したいときは fm.Router().On(...) を使う
+func (fm *FeatureManager) Router() *interactions.Router {
+	return fm.router
 }
 
 func (fm *FeatureManager) AddFeature(f *Feature) (err error) {
 	fm.Lock()
 	defer fm.Unlock()
+	if f.Data == nil && fm.store != nil {
+		f.Data = fm.store.For(string(f.Type), f.ID)
+	}
 	if f.Data == nil {
 		return ErrNoFeatureData
 	}
@@ -46,6 +112,37 @@ func (fm *FeatureManager) AddFeature(f *Feature) (err error) {
 	return nil
 }
 
+// 指定したスコープ (主にギルドID) で有効なフィーチャーの一覧を返す
+//
+// WithStore で渡したストアが featuredata.Lister を満たす場合、N回の
+// IsEnabled 呼び出しではなくストア側の1クエリで列挙する。
+// ストアが未設定か Lister を満たさない場合はエラーを返す
+func (fm *FeatureManager) List(scopeID string) ([]*Feature, error) {
+	if fm.store == nil {
+		return nil, errors.New("error: no store configured")
+	}
+	lister, ok := fm.store.(featuredata.Lister)
+	if !ok {
+		return nil, errors.New("error: store does not support listing")
+	}
+	refs, err := lister.ListEnabled(scopeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed list enabled features: %w", err)
+	}
+
+	fm.Lock()
+	defer fm.Unlock()
+	features := make([]*Feature, 0, len(refs))
+	for _, ref := range refs {
+		for _, f := range fm.featureMap[FeatureType(ref.Type)] {
+			if f.ID == ref.ID {
+				features = append(features, f)
+			}
+		}
+	}
+	return features, nil
+}
+
 type FeatureIDType string
 
 const (
@@ -94,74 +191,120 @@ type FeatureData interface {
 	IsEnabled(string) bool
 }
 
-func (fm *FeatureManager) Handler() func(*discordgo.Session, any) {
-	return func(s *discordgo.Session, a any) {
-		switch v := a.(type) {
-		case *discordgo.MessageCreate:
-			for _, f := range fm.featureMap[FeatureMessageCreate] {
-				fn, ok := f.Handler.(func(*discordgo.Session, *discordgo.MessageCreate))
-				if !ok {
-					continue
-				}
-				var equal bool
-				switch f.IDType {
-				case FeatureChannelID:
-					equal = f.Data.IsEnabled(v.ChannelID)
-				case FeatureGuildID:
-					equal = f.Data.IsEnabled(v.GuildID)
-				case FeatureUserID:
-					if v.Member != nil {
-						equal = f.Data.IsEnabled(v.Member.User.ID)
-					}
-				case FeatureRoleID:
-					m, err := s.GuildMember(v.GuildID, v.GuildID)
-					if err != nil {
-						continue
-					}
-					for _, r := range m.Roles {
-						if f.Data.IsEnabled(r) {
-							equal = true
-							break
-						}
-					}
-				}
-				if !equal {
-					continue
-				}
-				fn(s, v)
+// イベントからフィーチャーのゲーティングに必要な情報を取り出したもの
+type EventScope struct {
+	ChannelID string
+	GuildID   string
+	UserID    string
+}
+
+// FeatureType を動的に登録する
+//
+// extract はイベントの値からゲーティングに使う EventScope を取り出す関数。
+// 登録した FeatureType に対して AddFeature された Feature の Handler は
+// func(*discordgo.Session, T) でなければならない
+func RegisterEventType[T any](fm *FeatureManager, name FeatureType, extract func(T) EventScope) {
+	fm.eventTypes.Store(name, func(s *discordgo.Session, a any) {
+		v, ok := a.(T)
+		if !ok {
+			return
+		}
+		scope := extract(v)
+		for _, f := range fm.features(name) {
+			fn, ok := f.Handler.(func(*discordgo.Session, T))
+			if !ok {
+				continue
 			}
-		case *discordgo.TypingStart:
-			for _, f := range fm.featureMap[FeatureTypingStart] {
-				fn, ok := f.Handler.(func(*discordgo.Session, *discordgo.TypingStart))
-				if !ok {
-					continue
-				}
-				var equal bool
-				switch f.IDType {
-				case FeatureChannelID:
-					equal = f.Data.IsEnabled(v.ChannelID)
-				case FeatureGuildID:
-					equal = f.Data.IsEnabled(v.GuildID)
-				case FeatureUserID:
-					equal = f.Data.IsEnabled(v.UserID)
-				case FeatureRoleID:
-					m, err := s.GuildMember(v.GuildID, v.GuildID)
-					if err != nil {
-						continue
-					}
-					for _, r := range m.Roles {
-						if f.Data.IsEnabled(r) {
-							equal = true
-							break
-						}
-					}
-				}
-				if !equal {
-					continue
-				}
-				fn(s, v)
+			if !fm.scopeEnabled(s, f, scope) {
+				continue
 			}
+			fn(s, v)
 		}
+	})
+}
+
+func (fm *FeatureManager) features(t FeatureType) []*Feature {
+	fm.Lock()
+	defer fm.Unlock()
+	return fm.featureMap[t]
+}
+
+// Feature の IDType に応じて、このイベントに対して有効かどうかを判定する
+func (fm *FeatureManager) scopeEnabled(s *discordgo.Session, f *Feature, scope EventScope) bool {
+	switch f.IDType {
+	case FeatureChannelID:
+		return f.Data.IsEnabled(scope.ChannelID)
+	case FeatureGuildID:
+		return f.Data.IsEnabled(scope.GuildID)
+	case FeatureUserID:
+		return scope.UserID != "" && f.Data.IsEnabled(scope.UserID)
+	case FeatureRoleID:
+		roles, err := fm.memberRoles(s, scope.GuildID, scope.UserID)
+		if err != nil {
+			return false
+		}
+		for _, r := range roles {
+			if f.Data.IsEnabled(r) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// ギルド毎のメンバーロールキャッシュ。高トラフィックなギルドで毎メッセージ
+// GuildMember を叩かないようにするためのもの。GuildMemberUpdate で無効化する
+type memberRoleCache struct {
+	mu    sync.RWMutex
+	roles map[string][]string
+}
+
+func memberRoleCacheKey(guildID, userID string) string {
+	return guildID + ":" + userID
+}
+
+func (fm *FeatureManager) memberRoles(s *discordgo.Session, guildID, userID string) ([]string, error) {
+	key := memberRoleCacheKey(guildID, userID)
+	fm.roleCache.mu.RLock()
+	roles, ok := fm.roleCache.roles[key]
+	fm.roleCache.mu.RUnlock()
+	if ok {
+		return roles, nil
+	}
+	m, err := s.GuildMember(guildID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed get guild member: %w", err)
+	}
+	fm.roleCache.mu.Lock()
+	fm.roleCache.roles[key] = m.Roles
+	fm.roleCache.mu.Unlock()
+	return m.Roles, nil
+}
+
+// メンバーロールキャッシュを無効化するハンダラ
+//
+// s.AddHandler(fm.MemberRoleCacheInvalidationHandler()) で登録する
+func (fm *FeatureManager) MemberRoleCacheInvalidationHandler() func(*discordgo.Session, *discordgo.GuildMemberUpdate) {
+	return func(s *discordgo.Session, v *discordgo.GuildMemberUpdate) {
+		if v.Member == nil || v.Member.User == nil {
+			return
+		}
+		key := memberRoleCacheKey(v.GuildID, v.Member.User.ID)
+		fm.roleCache.mu.Lock()
+		delete(fm.roleCache.roles, key)
+		fm.roleCache.mu.Unlock()
+	}
+}
+
+// 登録済みの全 FeatureType を横断してイベントを配送する
+func (fm *FeatureManager) Handler() func(*discordgo.Session, any) {
+	return func(s *discordgo.Session, a any) {
+		fm.eventTypes.Range(func(_, value any) bool {
+			dispatch := value.(func(*discordgo.Session, any))
+			dispatch(s, a)
+			return true
+		})
 	}
 }
 
@@ -246,8 +389,12 @@ func (fm *FeatureManager) ApplicationCommandHandler() func(*discordgo.Session, *
 				if f.ID != featureID {
 					continue
 				}
-				var values []string
-				i, values = RequestFeatureIDRespond(s, i, f)
+				ic, values, err := fm.RequestFeatureIDRespond(context.Background(), s, i, f)
+				if err != nil {
+					logging.Error("コンポーネント応答待ちに失敗 %s", err)
+					continue
+				}
+				i = ic
 				for _, v := range values {
 					f.Data.Write(v)
 				}
@@ -262,7 +409,12 @@ func (fm *FeatureManager) ApplicationCommandHandler() func(*discordgo.Session, *
 	}
 }
 
-func RequestFeatureIDRespond(s *discordgo.Session, i *discordgo.InteractionCreate, f *Feature) (ic *discordgo.InteractionCreate, fID []string) {
+// フィーチャーのIDを選択させるコンポーネントを送り、ユーザーの応答を待つ
+//
+// 内部的には fm.Router() が持つ interactions.Router 経由でコンポーネントを待ち受けるため、
+// 応答を送ったユーザー以外が操作した場合は自動で弾かれ、ctx のタイムアウト/キャンセルで
+// 待受を打ち切れる
+func (fm *FeatureManager) RequestFeatureIDRespond(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, f *Feature) (ic *discordgo.InteractionCreate, fID []string, err error) {
 	var menuType discordgo.SelectMenuType
 	channelTypes := []discordgo.ChannelType{}
 	switch f.IDType {
@@ -274,7 +426,7 @@ func RequestFeatureIDRespond(s *discordgo.Session, i *discordgo.InteractionCreat
 	case FeatureUserID:
 		menuType = discordgo.UserSelectMenu
 	case FeatureGuildID:
-		return i, []string{i.GuildID}
+		return i, []string{i.GuildID}, nil
 	case FeatureCustom:
 		// TODO: 実装する
 	}
@@ -291,34 +443,29 @@ func RequestFeatureIDRespond(s *discordgo.Session, i *discordgo.InteractionCreat
 			},
 		},
 	}
-	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
 			Flags:      discordgo.MessageFlagsEphemeral,
 			Components: components,
 		},
-	})
+	}); err != nil {
+		return nil, nil, fmt.Errorf("レスポンスに失敗: %w", err)
+	}
+
+	ic, err = fm.router.Await(ctx, sessionID, interactions.AwaitOptions{OwnerUserID: invokerID(i)})
 	if err != nil {
-		logging.Error("レスポンスに失敗 %s", err)
-		return
+		return nil, nil, fmt.Errorf("コンポーネント応答待ちに失敗: %w", err)
 	}
-	var i1 *discordgo.InteractionCreate
-	// TODO: タイムアウトを追加
-	var c chan struct{}
-	var handler func(*discordgo.Session, *discordgo.InteractionCreate)
-	handler = func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		if i.Type == discordgo.InteractionMessageComponent {
-			s.AddHandlerOnce(handler)
-			return
-		}
-		if i.MessageComponentData().CustomID != sessionID {
-			s.AddHandlerOnce(handler)
-			return
-		}
-		i1 = i
-		close(c)
+	return ic, ic.MessageComponentData().Values, nil
+}
+
+func invokerID(i *discordgo.InteractionCreate) string {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User.ID
+	}
+	if i.User != nil {
+		return i.User.ID
 	}
-	s.AddHandlerOnce(handler)
-	<-c
-	return i1, i1.MessageComponentData().Values
+	return ""
 }
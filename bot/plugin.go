@@ -0,0 +1,133 @@
+/*
+	Copyright (C) 2022-2023  ikafly144
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package botlib
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sabafly/gobot-lib/logging"
+	"github.com/sabafly/gobot-lib/plugins"
+)
+
+// プラグインが登録する Feature は常に有効として扱う
+//
+// 本来の有効/無効の永続化は featuredata パッケージの Store が担う
+type alwaysEnabledFeatureData struct{}
+
+func (alwaysEnabledFeatureData) Write(string)          {}
+func (alwaysEnabledFeatureData) Delete(string)         {}
+func (alwaysEnabledFeatureData) IsEnabled(string) bool { return true }
+
+// BotManager を plugins.Host として公開するための薄いアダプタ
+type pluginHost struct {
+	b *BotManager
+}
+
+func (h *pluginHost) AddFeature(name, idType string, handler func(*discordgo.Session, *discordgo.MessageCreate)) error {
+	return h.b.features.AddFeature(&Feature{
+		Name:    name,
+		ID:      name,
+		IDType:  FeatureIDType(idType),
+		Type:    FeatureMessageCreate,
+		Data:    alwaysEnabledFeatureData{},
+		Handler: handler,
+	})
+}
+
+func (h *pluginHost) ApplicationCommandRegister(name string, handler func(*discordgo.Session, *discordgo.InteractionCreate)) {
+	h.b.RegisterApplicationCommandHandler(name, handler)
+}
+
+// プラグインディレクトリを読み込み、/plugin コマンドを登録する
+func (b *BotManager) EnablePlugins(dir string, opts ...plugins.Option) error {
+	b.plugins = plugins.NewManager(&pluginHost{b: b}, dir, opts...)
+	if err := b.plugins.LoadDir(dir); err != nil {
+		return fmt.Errorf("failed load plugins: %w", err)
+	}
+	b.AddHandler(func(s *discordgo.Session, v *discordgo.MessageCreate) {
+		b.plugins.DispatchMessage(s, v)
+	})
+	b.RegisterApplicationCommandHandler("plugin", b.pluginCommandHandler)
+	return nil
+}
+
+// /plugin enable|disable|list|reload のベースとなる ApplicationCommand
+func (b *BotManager) PluginApplicationCommand() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        "plugin",
+		Description: "プラグインを管理する",
+		Options: []*discordgo.ApplicationCommandOption{
+			{Name: "enable", Description: "enable a plugin", Type: discordgo.ApplicationCommandOptionSubCommand, Options: []*discordgo.ApplicationCommandOption{
+				{Name: "name", Description: "plugin name", Type: discordgo.ApplicationCommandOptionString, Required: true},
+			}},
+			{Name: "disable", Description: "disable a plugin", Type: discordgo.ApplicationCommandOptionSubCommand, Options: []*discordgo.ApplicationCommandOption{
+				{Name: "name", Description: "plugin name", Type: discordgo.ApplicationCommandOptionString, Required: true},
+			}},
+			{Name: "list", Description: "list loaded plugins", Type: discordgo.ApplicationCommandOptionSubCommand},
+			{Name: "reload", Description: "reload a plugin", Type: discordgo.ApplicationCommandOptionSubCommand, Options: []*discordgo.ApplicationCommandOption{
+				{Name: "name", Description: "plugin name", Type: discordgo.ApplicationCommandOptionString, Required: true},
+			}},
+		},
+	}
+}
+
+func (b *BotManager) pluginCommandHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	acd := i.ApplicationCommandData()
+	if len(acd.Options) == 0 {
+		return
+	}
+	sub := acd.Options[0]
+	reply := func(content string) {
+		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{Content: content, Flags: discordgo.MessageFlagsEphemeral},
+		}); err != nil {
+			logging.Error("インタラクションに失敗 %s", err)
+		}
+	}
+	switch sub.Name {
+	case "enable":
+		name := sub.Options[0].StringValue()
+		if err := b.plugins.Enable(name); err != nil {
+			reply(err.Error())
+			return
+		}
+		reply(fmt.Sprintf("%s を有効にしました", name))
+	case "disable":
+		name := sub.Options[0].StringValue()
+		if err := b.plugins.Disable(name); err != nil {
+			reply(err.Error())
+			return
+		}
+		reply(fmt.Sprintf("%s を無効にしました", name))
+	case "reload":
+		name := sub.Options[0].StringValue()
+		if err := b.plugins.Reload(name); err != nil {
+			reply(err.Error())
+			return
+		}
+		reply(fmt.Sprintf("%s を再読み込みしました", name))
+	case "list":
+		list := b.plugins.List()
+		content := fmt.Sprintf("%d 個のプラグインが読み込まれています", len(list))
+		for _, p := range list {
+			content += fmt.Sprintf("\n- %s", p.Name)
+		}
+		reply(content)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+	Copyright (C) 2022-2023  ikafly144
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package botlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// サブシステムが実装するライフサイクル契約
+//
+// bot/system_*.go にある features/interactions/commands は既定で Register される。
+// persistence/plugins のように接続先が利用側ごとに異なるものや、ダウンストリームが
+// 自前で追加する starboard/tickets/polls のようなサブシステムは呼び出し側が Register する
+type System interface {
+	Name() string
+	Init(*BotManager) error
+}
+
+// Init の後に非同期処理を始めたいシステムが実装する
+type Starter interface {
+	Start(ctx context.Context) error
+}
+
+// Close 時に後始末をしたいシステムが実装する
+type Stopper interface {
+	Stop(ctx context.Context) error
+}
+
+// 他のシステムの初期化が終わってから初期化されたいシステムが実装する
+//
+// 例えばコマンドの登録はフィーチャーやプラグインがコマンドを登録し終えた後で
+// なければならないため、"commands" システムは常にこれで依存を宣言する
+type DependsOn interface {
+	DependsOn() []string
+}
+
+// サブシステムを登録する
+//
+// 登録しただけでは Init は呼ばれず、Open が依存関係を解決してから呼び出す
+func (b *BotManager) Register(s System) {
+	b.systemsMu.Lock()
+	defer b.systemsMu.Unlock()
+	if b.systems == nil {
+		b.systems = map[string]System{}
+	}
+	b.systems[s.Name()] = s
+}
+
+// 依存関係を解決し、System をトポロジカル順に並べる
+//
+// 同点のシステム同士は名前順になる (実行順を決定的にするため)。ただし "commands" は
+// 他のシステムから依存されていない限り常に最後になる
+func (b *BotManager) resolveSystemOrder() ([]System, error) {
+	b.systemsMu.RLock()
+	defer b.systemsMu.RUnlock()
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[string]int{}
+	var order []System
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("error: dependency cycle detected at system %q", name)
+		}
+		s, ok := b.systems[name]
+		if !ok {
+			// 未登録の依存先は任意の依存として無視する (例: plugins を使わない構成)
+			state[name] = done
+			return nil
+		}
+		state[name] = visiting
+		if d, ok := s.(DependsOn); ok {
+			for _, dep := range d.DependsOn() {
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = done
+		order = append(order, s)
+		return nil
+	}
+
+	names := make([]string, 0, len(b.systems))
+	for name := range b.systems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// "commands" は名前順に関係なく最後に辿り、他のすべてのシステムより後に初期化する
+	for i, name := range names {
+		if name == "commands" {
+			names = append(append(names[:i:i], names[i+1:]...), name)
+			break
+		}
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// 登録済みシステムを依存順に初期化する。Open から呼ばれる
+func (b *BotManager) initSystems() error {
+	order, err := b.resolveSystemOrder()
+	if err != nil {
+		return fmt.Errorf("failed resolve system order: %w", err)
+	}
+	var errs []error
+	for _, s := range order {
+		if err := s.Init(b); err != nil {
+			errs = append(errs, fmt.Errorf("system %s: failed init: %w", s.Name(), err))
+			continue
+		}
+		if starter, ok := s.(Starter); ok {
+			if err := starter.Start(context.Background()); err != nil {
+				errs = append(errs, fmt.Errorf("system %s: failed start: %w", s.Name(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 登録済みシステムを依存関係の逆順に停止する。Close から呼ばれる
+func (b *BotManager) stopSystems() error {
+	order, err := b.resolveSystemOrder()
+	if err != nil {
+		return fmt.Errorf("failed resolve system order: %w", err)
+	}
+	var errs []error
+	for i := len(order) - 1; i >= 0; i-- {
+		s := order[i]
+		stopper, ok := s.(Stopper)
+		if !ok {
+			continue
+		}
+		if err := stopper.Stop(context.Background()); err != nil {
+			errs = append(errs, fmt.Errorf("system %s: failed stop: %w", s.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
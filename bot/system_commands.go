@@ -0,0 +1,38 @@
+/*
+	Copyright (C) 2022-2023  ikafly144
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package botlib
+
+// アプリケーションコマンドのハンダラ登録を行う System
+//
+// フィーチャーやプラグインが動的にコマンドを追加し終えてから登録したいため、
+// 依存するシステムのうち最後に初期化されるよう DependsOn で宣言している。
+// New()/validateShards() から既定で Register される
+type commandsSystem struct{}
+
+func newCommandsSystem() *commandsSystem {
+	return &commandsSystem{}
+}
+
+func (s *commandsSystem) Name() string { return "commands" }
+
+// commands システムは常に最後に初期化される
+func (s *commandsSystem) DependsOn() []string { return []string{"features", "interactions", "plugins"} }
+
+func (s *commandsSystem) Init(b *BotManager) error {
+	b.AddHandler(b.Features().ApplicationCommandHandler())
+	return nil
+}
@@ -0,0 +1,37 @@
+/*
+	Copyright (C) 2022-2023  ikafly144
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package botlib
+
+// FeatureManager が持つイベントハンダラをセッションに登録する System
+//
+// New()/validateShards() から既定で Register されるため、呼び出し側が
+// 個別に組み立てる必要はない
+type featuresSystem struct{}
+
+func newFeaturesSystem() *featuresSystem {
+	return &featuresSystem{}
+}
+
+func (s *featuresSystem) Name() string { return "features" }
+
+func (s *featuresSystem) Init(b *BotManager) error {
+	fm := b.Features()
+	b.AddHandler(fm.Handler())
+	b.AddHandler(fm.Router().Handler())
+	b.AddHandler(fm.MemberRoleCacheInvalidationHandler())
+	return nil
+}
@@ -0,0 +1,52 @@
+/*
+	Copyright (C) 2022-2023  ikafly144
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package botlib
+
+import (
+	"context"
+	"fmt"
+)
+
+// FeatureManager が内包する interactions.Router を System として扱う薄いラッパー
+//
+// New()/validateShards() から既定で Register される
+type interactionsSystem struct {
+	b *BotManager
+}
+
+func newInteractionsSystem() *interactionsSystem {
+	return &interactionsSystem{}
+}
+
+func (s *interactionsSystem) Name() string { return "interactions" }
+
+// Router は features システムの Init で AddHandler されるため、ここでは
+// Router が生成されていることだけを確認する
+func (s *interactionsSystem) Init(b *BotManager) error {
+	if b.Features().Router() == nil {
+		return fmt.Errorf("error: interactions router is not initialized")
+	}
+	s.b = b
+	return nil
+}
+
+func (s *interactionsSystem) DependsOn() []string { return []string{"features"} }
+
+// 待受中の Await をすべて打ち切り、janitor を止める
+func (s *interactionsSystem) Stop(ctx context.Context) error {
+	return s.b.Features().Router().Close()
+}
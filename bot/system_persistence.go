@@ -0,0 +1,47 @@
+/*
+	Copyright (C) 2022-2023  ikafly144
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package botlib
+
+import (
+	"fmt"
+
+	"github.com/sabafly/gobot-lib/featuredata"
+)
+
+// featuredata.SQLStore のマイグレーションを実行し、FeatureManager の既定ストアとして
+// 結びつける System
+//
+// 接続先は利用側ごとに異なるため既定では Register されない。使うには
+// b.Register(botlib.NewPersistenceSystem(store)) を Open より前に呼ぶ
+type PersistenceSystem struct {
+	Store *featuredata.SQLStore
+}
+
+// NewPersistenceSystem は既にマイグレーション前の *featuredata.SQLStore からシステムを作る
+func NewPersistenceSystem(store *featuredata.SQLStore) *PersistenceSystem {
+	return &PersistenceSystem{Store: store}
+}
+
+func (s *PersistenceSystem) Name() string { return "persistence" }
+
+func (s *PersistenceSystem) Init(b *BotManager) error {
+	if err := s.Store.Migrate(); err != nil {
+		return fmt.Errorf("failed migrate feature store: %w", err)
+	}
+	b.Features().SetStore(s.Store)
+	return nil
+}
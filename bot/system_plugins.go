@@ -0,0 +1,41 @@
+/*
+	Copyright (C) 2022-2023  ikafly144
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package botlib
+
+import "github.com/sabafly/gobot-lib/plugins"
+
+// プラグインディレクトリを読み込んで /plugin コマンドを登録する System
+//
+// プラグインディレクトリは利用側ごとに異なるため既定では Register されない。
+// 使うには b.Register(botlib.NewPluginsSystem(dir, opts...)) を Open より前に呼ぶ
+type PluginsSystem struct {
+	Dir  string
+	Opts []plugins.Option
+}
+
+// NewPluginsSystem はプラグインディレクトリを指定してシステムを作る
+func NewPluginsSystem(dir string, opts ...plugins.Option) *PluginsSystem {
+	return &PluginsSystem{Dir: dir, Opts: opts}
+}
+
+func (s *PluginsSystem) Name() string { return "plugins" }
+
+func (s *PluginsSystem) DependsOn() []string { return []string{"features"} }
+
+func (s *PluginsSystem) Init(b *BotManager) error {
+	return b.EnablePlugins(s.Dir, s.Opts...)
+}
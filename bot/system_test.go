@@ -0,0 +1,82 @@
+/*
+	Copyright (C) 2022-2023  ikafly144
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package botlib
+
+import "testing"
+
+// テスト用の最小な System。依存先は固定で持たせる
+type stubSystem struct {
+	name string
+	deps []string
+}
+
+func (s *stubSystem) Name() string           { return s.name }
+func (s *stubSystem) DependsOn() []string    { return s.deps }
+func (s *stubSystem) Init(*BotManager) error { return nil }
+
+func TestResolveSystemOrderRespectsDependencies(t *testing.T) {
+	b := &BotManager{}
+	b.Register(&stubSystem{name: "commands", deps: []string{"features", "interactions"}})
+	b.Register(&stubSystem{name: "interactions", deps: []string{"features"}})
+	b.Register(&stubSystem{name: "features"})
+
+	order, err := b.resolveSystemOrder()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pos := map[string]int{}
+	for i, s := range order {
+		pos[s.Name()] = i
+	}
+	if pos["features"] > pos["interactions"] {
+		t.Fatalf("features must be initialized before interactions, got order %v", names(order))
+	}
+	if pos["interactions"] > pos["commands"] {
+		t.Fatalf("interactions must be initialized before commands, got order %v", names(order))
+	}
+}
+
+func TestResolveSystemOrderIgnoresUnregisteredDependency(t *testing.T) {
+	b := &BotManager{}
+	b.Register(&stubSystem{name: "commands", deps: []string{"plugins"}})
+
+	order, err := b.resolveSystemOrder()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(order) != 1 || order[0].Name() != "commands" {
+		t.Fatalf("expected only commands in order, got %v", names(order))
+	}
+}
+
+func TestResolveSystemOrderDetectsCycle(t *testing.T) {
+	b := &BotManager{}
+	b.Register(&stubSystem{name: "a", deps: []string{"b"}})
+	b.Register(&stubSystem{name: "b", deps: []string{"a"}})
+
+	if _, err := b.resolveSystemOrder(); err == nil {
+		t.Fatal("expected cycle detection error, got nil")
+	}
+}
+
+func names(systems []System) []string {
+	out := make([]string, len(systems))
+	for i, s := range systems {
+		out[i] = s.Name()
+	}
+	return out
+}
@@ -0,0 +1,71 @@
+/*
+	Copyright (C) 2022-2023  ikafly144
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package featuredata
+
+// 複数のバックエンドに書き込み、先頭のバックエンドから読み出すストア
+//
+// 例えば移行期間中に SQLStore と MemoryStore の両方へ書いておき、
+// 不整合が起きていないか突き合わせたい場合などに使う
+type MultiStore struct {
+	stores []Store
+}
+
+// NewMultiStore は1つ以上の Store から MultiStore を作る
+func NewMultiStore(stores ...Store) *MultiStore {
+	return &MultiStore{stores: stores}
+}
+
+func (m *MultiStore) For(featureType, featureID string) FeatureData {
+	views := make([]FeatureData, len(m.stores))
+	for i, s := range m.stores {
+		views[i] = s.For(featureType, featureID)
+	}
+	return &multiFeatureData{views: views}
+}
+
+func (m *MultiStore) ListEnabled(scopeID string) ([]FeatureRef, error) {
+	if len(m.stores) == 0 {
+		return nil, nil
+	}
+	if lister, ok := m.stores[0].(Lister); ok {
+		return lister.ListEnabled(scopeID)
+	}
+	return nil, nil
+}
+
+type multiFeatureData struct {
+	views []FeatureData
+}
+
+func (d *multiFeatureData) Write(scopeID string) {
+	for _, v := range d.views {
+		v.Write(scopeID)
+	}
+}
+
+func (d *multiFeatureData) Delete(scopeID string) {
+	for _, v := range d.views {
+		v.Delete(scopeID)
+	}
+}
+
+func (d *multiFeatureData) IsEnabled(scopeID string) bool {
+	if len(d.views) == 0 {
+		return false
+	}
+	return d.views[0].IsEnabled(scopeID)
+}
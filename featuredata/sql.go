@@ -0,0 +1,153 @@
+/*
+	Copyright (C) 2022-2023  ikafly144
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package featuredata
+
+import (
+	"embed"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sabafly/gobot-lib/logging"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// database/sql (sqlite/postgres) をバックエンドにした Store
+//
+// feature_toggles(feature_type, feature_id, scope_id) に行があれば有効、
+// なければ無効として扱う
+type SQLStore struct {
+	db *sqlx.DB
+}
+
+// 既存の *sqlx.DB からストアを作る。Migrate を呼ぶまでテーブルは作成されない
+func NewSQLStore(db *sqlx.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// schema_version を見ながら migrations/ 以下の .sql を辞書順に適用する
+func (s *SQLStore) Migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return fmt.Errorf("failed create schema_version table: %w", err)
+	}
+
+	var current int
+	if err := s.db.Get(&current, `SELECT COALESCE(MAX(version), 0) FROM schema_version`); err != nil {
+		return fmt.Errorf("failed read schema_version: %w", err)
+	}
+
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return fmt.Errorf("failed read migrations: %w", err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		version := i + 1
+		if version <= current {
+			continue
+		}
+		sqlBytes, err := migrationFiles.ReadFile("migrations/" + name)
+		if err != nil {
+			return fmt.Errorf("failed read migration %s: %w", name, err)
+		}
+		tx, err := s.db.Beginx()
+		if err != nil {
+			return fmt.Errorf("failed begin tx for migration %s: %w", name, err)
+		}
+		if _, err := tx.Exec(string(sqlBytes)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed apply migration %s: %w", name, err)
+		}
+		if _, err := tx.Exec(tx.Rebind(`INSERT INTO schema_version (version) VALUES (?)`), version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed record migration %s: %w", name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed commit migration %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) For(featureType, featureID string) FeatureData {
+	return &sqlFeatureData{db: s.db, featureType: featureType, featureID: featureID}
+}
+
+func (s *SQLStore) ListEnabled(scopeID string) ([]FeatureRef, error) {
+	var refs []FeatureRef
+	rows, err := s.db.Query(s.db.Rebind(`SELECT feature_type, feature_id FROM feature_toggles WHERE scope_id = ?`), scopeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed list enabled features: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ref FeatureRef
+		if err := rows.Scan(&ref.Type, &ref.ID); err != nil {
+			return nil, fmt.Errorf("failed scan enabled feature: %w", err)
+		}
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
+
+type sqlFeatureData struct {
+	db          *sqlx.DB
+	featureType string
+	featureID   string
+}
+
+func (d *sqlFeatureData) Write(scopeID string) {
+	if _, err := d.db.Exec(
+		d.db.Rebind(`INSERT INTO feature_toggles (feature_type, feature_id, scope_id) VALUES (?, ?, ?)
+		 ON CONFLICT (feature_type, feature_id, scope_id) DO NOTHING`),
+		d.featureType, d.featureID, scopeID,
+	); err != nil {
+		logging.Error("フィーチャーの有効化に失敗 %s", err)
+	}
+}
+
+func (d *sqlFeatureData) Delete(scopeID string) {
+	if _, err := d.db.Exec(
+		d.db.Rebind(`DELETE FROM feature_toggles WHERE feature_type = ? AND feature_id = ? AND scope_id = ?`),
+		d.featureType, d.featureID, scopeID,
+	); err != nil {
+		logging.Error("フィーチャーの無効化に失敗 %s", err)
+	}
+}
+
+func (d *sqlFeatureData) IsEnabled(scopeID string) bool {
+	var count int
+	if err := d.db.Get(&count,
+		d.db.Rebind(`SELECT COUNT(*) FROM feature_toggles WHERE feature_type = ? AND feature_id = ? AND scope_id = ?`),
+		d.featureType, d.featureID, scopeID,
+	); err != nil {
+		logging.Error("フィーチャーの有効状態の取得に失敗 %s", err)
+		return false
+	}
+	return count > 0
+}
@@ -0,0 +1,120 @@
+/*
+	Copyright (C) 2022-2023  ikafly144
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+// Package featuredata は botlib.FeatureData の永続化実装を提供する
+package featuredata
+
+import "sync"
+
+// botlib.FeatureData と同じ形の有効/無効データ
+//
+// featuredata はこの形で FeatureData を実装するので、botlib から見れば
+// 単にその FeatureData インターフェースを満たす値として扱える
+type FeatureData interface {
+	Write(string)
+	Delete(string)
+	IsEnabled(string) bool
+}
+
+// feature_type/feature_id を指定して FeatureData のビューを払い出すストア
+type Store interface {
+	For(featureType, featureID string) FeatureData
+}
+
+// scope_id を指定して有効なフィーチャーを列挙できるストア
+//
+// 実装が対応していれば Store は同時にこれも満たす
+type Lister interface {
+	ListEnabled(scopeID string) ([]FeatureRef, error)
+}
+
+// feature_type と feature_id の組
+type FeatureRef struct {
+	Type string
+	ID   string
+}
+
+// テスト用のインメモリストア
+type MemoryStore struct {
+	mu   sync.RWMutex
+	rows map[string]map[string]struct{} // feature_type:feature_id -> scope_id set
+}
+
+// 新規のインメモリストアを作成する
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{rows: map[string]map[string]struct{}{}}
+}
+
+func (m *MemoryStore) For(featureType, featureID string) FeatureData {
+	return &memoryFeatureData{store: m, key: featureType + ":" + featureID, featureType: featureType, featureID: featureID}
+}
+
+func (m *MemoryStore) ListEnabled(scopeID string) ([]FeatureRef, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var refs []FeatureRef
+	for key, scopes := range m.rows {
+		if _, ok := scopes[scopeID]; !ok {
+			continue
+		}
+		t, id, ok := splitKey(key)
+		if !ok {
+			continue
+		}
+		refs = append(refs, FeatureRef{Type: t, ID: id})
+	}
+	return refs, nil
+}
+
+func splitKey(key string) (featureType, featureID string, ok bool) {
+	for i := 0; i < len(key); i++ {
+		if key[i] == ':' {
+			return key[:i], key[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+type memoryFeatureData struct {
+	store       *MemoryStore
+	key         string
+	featureType string
+	featureID   string
+}
+
+func (d *memoryFeatureData) Write(scopeID string) {
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+	scopes, ok := d.store.rows[d.key]
+	if !ok {
+		scopes = map[string]struct{}{}
+		d.store.rows[d.key] = scopes
+	}
+	scopes[scopeID] = struct{}{}
+}
+
+func (d *memoryFeatureData) Delete(scopeID string) {
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+	delete(d.store.rows[d.key], scopeID)
+}
+
+func (d *memoryFeatureData) IsEnabled(scopeID string) bool {
+	d.store.mu.RLock()
+	defer d.store.mu.RUnlock()
+	_, ok := d.store.rows[d.key][scopeID]
+	return ok
+}
@@ -0,0 +1,240 @@
+/*
+	Copyright (C) 2022-2023  ikafly144
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+// Package interactions はコンポーネントインタラクション (CustomID) のルーティングを行う
+package interactions
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sabafly/gobot-lib/logging"
+)
+
+// 招待ユーザー以外がクリックしたときの返答
+const ownerOnlyMessage = "このコンポーネントを使用できるのはコマンドを実行したユーザーのみです"
+
+// 長命なコンポーネントハンダラ (ページング等)
+type Handler func(*discordgo.Session, *discordgo.InteractionCreate)
+
+// Await に渡すオプション
+type AwaitOptions struct {
+	// 指定すると、このユーザー以外のクリックは弾いて ownerOnlyMessage を返す
+	OwnerUserID string
+	// 待受時間。0 の場合は既定値 (5分) を使う
+	Timeout time.Duration
+}
+
+const defaultAwaitTimeout = 5 * time.Minute
+
+// Await で待受中の1セッション
+type waiter struct {
+	deadline time.Time
+	owner    string
+	ch       chan *discordgo.InteractionCreate
+}
+
+// CustomID を鍵にインタラクションを振り分ける
+//
+// RequestFeatureIDRespond が使っていた AddHandlerOnce + 手書きチャネルの置き換え
+type Router struct {
+	mu       sync.Mutex
+	waiters  map[string]*waiter
+	handlers map[string]Handler
+
+	janitorInterval time.Duration
+	stop            chan struct{}
+	stopOnce        sync.Once
+}
+
+// Router を作成する。janitorInterval は期限切れセッションを掃除する間隔
+func NewRouter(janitorInterval time.Duration) *Router {
+	if janitorInterval <= 0 {
+		janitorInterval = time.Minute
+	}
+	r := &Router{
+		waiters:         map[string]*waiter{},
+		handlers:        map[string]Handler{},
+		janitorInterval: janitorInterval,
+		stop:            make(chan struct{}),
+	}
+	go r.janitor()
+	return r
+}
+
+// customID 宛のインタラクションを1回だけ待ち受ける
+//
+// Timeout (または ctx の期限) に達すると context.DeadlineExceeded を、ctx がキャンセルされると
+// context.Canceled を返す。CancelAll/Close で打ち切られた場合もエラーを返す
+func (r *Router) Await(ctx context.Context, customID string, opts AwaitOptions) (*discordgo.InteractionCreate, error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultAwaitTimeout
+	}
+	ch := make(chan *discordgo.InteractionCreate, 1)
+	r.mu.Lock()
+	r.waiters[customID] = &waiter{
+		deadline: time.Now().Add(timeout),
+		owner:    opts.OwnerUserID,
+		ch:       ch,
+	}
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	select {
+	case ic, ok := <-ch:
+		if !ok {
+			return nil, fmt.Errorf("error: component wait for %s was cancelled", customID)
+		}
+		return ic, nil
+	case <-ctx.Done():
+		r.mu.Lock()
+		delete(r.waiters, customID)
+		r.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// customID 宛のインタラクションを継続的に受け取るハンダラを登録する
+//
+// ページング等、1回で終わらないコンポーネントのために使う
+func (r *Router) On(customID string, handler Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[customID] = handler
+}
+
+// 登録済みの長命ハンダラを取り外す
+func (r *Router) Off(customID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.handlers, customID)
+}
+
+// s.AddHandler に渡すディスパッチ関数
+func (r *Router) Handler() func(*discordgo.Session, *discordgo.InteractionCreate) {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		if i.Type != discordgo.InteractionMessageComponent && i.Type != discordgo.InteractionModalSubmit {
+			return
+		}
+		customID := customIDOf(i)
+
+		userID := userIDOf(i)
+
+		r.mu.Lock()
+		w, isWaiter := r.waiters[customID]
+		if isWaiter && w.owner != "" && userID != w.owner {
+			// 所有者以外のクリックでは待受を残し、所有者のクリックを待ち続ける
+			r.mu.Unlock()
+			respondOwnerOnly(s, i)
+			return
+		}
+		if isWaiter {
+			delete(r.waiters, customID)
+		}
+		h, isHandler := r.handlers[customID]
+		r.mu.Unlock()
+
+		if isWaiter {
+			w.ch <- i
+			return
+		}
+		if isHandler {
+			h(s, i)
+		}
+	}
+}
+
+func respondOwnerOnly(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: ownerOnlyMessage,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		logging.Error("所有者チェックの応答に失敗 %s", err)
+	}
+}
+
+func customIDOf(i *discordgo.InteractionCreate) string {
+	switch i.Type {
+	case discordgo.InteractionMessageComponent:
+		return i.MessageComponentData().CustomID
+	case discordgo.InteractionModalSubmit:
+		return i.ModalSubmitData().CustomID
+	default:
+		return ""
+	}
+}
+
+func userIDOf(i *discordgo.InteractionCreate) string {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User.ID
+	}
+	if i.User != nil {
+		return i.User.ID
+	}
+	return ""
+}
+
+// 期限切れの Await セッションを定期的に掃除する
+func (r *Router) janitor() {
+	ticker := time.NewTicker(r.janitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			r.mu.Lock()
+			for id, w := range r.waiters {
+				if now.After(w.deadline) {
+					delete(r.waiters, id)
+				}
+			}
+			r.mu.Unlock()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// 待受中の全 Await を打ち切る
+//
+// 打ち切られた Await はエラーを返す。BotManager.Close のようなシャットダウン処理から呼ぶ
+func (r *Router) CancelAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, w := range r.waiters {
+		close(w.ch)
+		delete(r.waiters, id)
+	}
+}
+
+// 待受中の全 Await を打ち切り、janitor を止める
+func (r *Router) Close() error {
+	r.CancelAll()
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+	return nil
+}
@@ -0,0 +1,128 @@
+/*
+	Copyright (C) 2022-2023  ikafly144
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package interactions
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// respondOwnerOnly が Discord への HTTP リクエストで長く待たないよう、
+// すぐタイムアウトするクライアントを積んだ Session を用意する
+func newTestSession(t *testing.T) *discordgo.Session {
+	t.Helper()
+	s, err := discordgo.New("")
+	if err != nil {
+		t.Fatalf("failed create session: %v", err)
+	}
+	s.Client = &http.Client{Timeout: 10 * time.Millisecond}
+	s.MaxRestRetries = 0
+	return s
+}
+
+func componentInteraction(customID, userID string) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{
+		Interaction: &discordgo.Interaction{
+			Type:   discordgo.InteractionMessageComponent,
+			Member: &discordgo.Member{User: &discordgo.User{ID: userID}},
+			Data:   discordgo.MessageComponentInteractionData{CustomID: customID},
+		},
+	}
+}
+
+func TestRouterAwaitTimeout(t *testing.T) {
+	r := NewRouter(time.Minute)
+	t.Cleanup(func() { _ = r.Close() })
+
+	ctx := context.Background()
+	start := time.Now()
+	_, err := r.Await(ctx, "no-such-click", AwaitOptions{Timeout: 20 * time.Millisecond})
+	if err == nil {
+		t.Fatal("expected timeout error, got nil")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Await took too long to time out: %v", elapsed)
+	}
+}
+
+func TestRouterAwaitDeliversToOwner(t *testing.T) {
+	r := NewRouter(time.Minute)
+	t.Cleanup(func() { _ = r.Close() })
+
+	const customID = "confirm"
+	resultCh := make(chan *discordgo.InteractionCreate, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		ic, err := r.Await(context.Background(), customID, AwaitOptions{OwnerUserID: "owner-1", Timeout: time.Second})
+		resultCh <- ic
+		errCh <- err
+	}()
+
+	// waiter が登録されるまで待つ
+	time.Sleep(10 * time.Millisecond)
+
+	s := newTestSession(t)
+	want := componentInteraction(customID, "owner-1")
+	r.Handler()(s, want)
+
+	select {
+	case got := <-resultCh:
+		if got != want {
+			t.Fatalf("Await returned unexpected interaction: %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Await did not return after matching owner clicked")
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRouterAwaitRejectsNonOwner(t *testing.T) {
+	r := NewRouter(time.Minute)
+	t.Cleanup(func() { _ = r.Close() })
+
+	const customID = "confirm"
+	resultCh := make(chan *discordgo.InteractionCreate, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		ic, err := r.Await(context.Background(), customID, AwaitOptions{OwnerUserID: "owner-1", Timeout: 50 * time.Millisecond})
+		resultCh <- ic
+		errCh <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+
+	s := newTestSession(t)
+	r.Handler()(s, componentInteraction(customID, "someone-else"))
+
+	select {
+	case got := <-resultCh:
+		if got != nil {
+			t.Fatalf("non-owner click should not have been delivered, got %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Await goroutine did not finish")
+	}
+	if err := <-errCh; err == nil {
+		t.Fatal("expected Await to fail after the only click came from a non-owner")
+	}
+}
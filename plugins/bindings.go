@@ -0,0 +1,229 @@
+/*
+	Copyright (C) 2022-2023  ikafly144
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package plugins
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sql ビルトインがテーブル名に組み込んでも安全なプラグイン名の形式
+var safePluginNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// fetch ビルトインの挙動を制限する設定
+type FetchOptions struct {
+	Timeout   time.Duration
+	AllowHost []string
+}
+
+// fetch のデフォルト設定 (5秒 / ホスト制限なし)
+func DefaultFetchOptions() FetchOptions {
+	return FetchOptions{Timeout: 5 * time.Second}
+}
+
+func (o FetchOptions) allowed(u *url.URL) bool {
+	if len(o.AllowHost) == 0 {
+		return true
+	}
+	for _, h := range o.AllowHost {
+		if strings.EqualFold(h, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// sql ビルトインが使う *sql.DB を用意する関数
+type SQLOpenFunc func(pluginName string) (*sql.DB, error)
+
+func defaultSQLOpen(pluginName string) (*sql.DB, error) {
+	return sql.Open("sqlite3", fmt.Sprintf("plugin_%s.db", pluginName))
+}
+
+// VM にビルトイン (discord / fetch / sql / bot) を登録する
+func registerBuiltins(m *Manager, p *Plugin) error {
+	if err := p.vm.Set("discord", newDiscordBuiltin(p)); err != nil {
+		return err
+	}
+	if err := p.vm.Set("fetch", newFetchBuiltin(m)); err != nil {
+		return err
+	}
+	db, err := m.sqlOpen(p.Name)
+	if err != nil {
+		return fmt.Errorf("failed open plugin db: %w", err)
+	}
+	p.db = db
+	sqlBuiltin, err := newSQLBuiltin(p, db)
+	if err != nil {
+		return fmt.Errorf("failed register sql builtin for %s: %w", p.Name, err)
+	}
+	if err := p.vm.Set("sql", sqlBuiltin); err != nil {
+		return err
+	}
+	if err := p.vm.Set("bot", newBotBuiltin(m, p)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// *discordgo.Session のうちプラグインに許可する操作のみを公開する
+//
+// 実際のセッションは Plugin.dispatch が呼び出しの間だけ差し込む
+func newDiscordBuiltin(p *Plugin) map[string]any {
+	noSession := func() error { return fmt.Errorf("discord: no active session for this dispatch") }
+	return map[string]any{
+		"sendMessage": func(channelID, content string) (map[string]any, error) {
+			if p.session == nil {
+				return nil, noSession()
+			}
+			msg, err := p.session.ChannelMessageSend(channelID, content)
+			if err != nil {
+				return nil, fmt.Errorf("discord.sendMessage: %w", err)
+			}
+			return mapMessage(msg), nil
+		},
+		"editMessage": func(channelID, messageID, content string) (map[string]any, error) {
+			if p.session == nil {
+				return nil, noSession()
+			}
+			msg, err := p.session.ChannelMessageEdit(channelID, messageID, content)
+			if err != nil {
+				return nil, fmt.Errorf("discord.editMessage: %w", err)
+			}
+			return mapMessage(msg), nil
+		},
+		"addReaction": func(channelID, messageID, emoji string) error {
+			if p.session == nil {
+				return noSession()
+			}
+			if err := p.session.MessageReactionAdd(channelID, messageID, emoji); err != nil {
+				return fmt.Errorf("discord.addReaction: %w", err)
+			}
+			return nil
+		},
+		"guildMember": func(guildID, userID string) (map[string]any, error) {
+			if p.session == nil {
+				return nil, noSession()
+			}
+			member, err := p.session.GuildMember(guildID, userID)
+			if err != nil {
+				return nil, fmt.Errorf("discord.guildMember: %w", err)
+			}
+			return mapMember(member), nil
+		},
+	}
+}
+
+// net/http を使ったシンプルな fetch。ホスト許可リストとタイムアウトを適用する
+func newFetchBuiltin(m *Manager) func(string) (map[string]any, error) {
+	return func(rawURL string) (map[string]any, error) {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("fetch: invalid url: %w", err)
+		}
+		if !m.fetchOpts.allowed(u) {
+			return nil, fmt.Errorf("fetch: host %s is not allowed", u.Hostname())
+		}
+		client := http.Client{Timeout: m.fetchOpts.Timeout}
+		resp, err := client.Get(u.String())
+		if err != nil {
+			return nil, fmt.Errorf("fetch: request failed: %w", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("fetch: failed read body: %w", err)
+		}
+		return map[string]any{
+			"status": resp.StatusCode,
+			"body":   string(body),
+		}, nil
+	}
+}
+
+// プラグイン毎の sqlite テーブルに対する単純な key-value 操作
+//
+// テーブル名にプラグイン名をそのまま埋め込むため、先に安全な識別子かどうかを確認する
+func newSQLBuiltin(p *Plugin, db *sql.DB) (map[string]any, error) {
+	if !safePluginNamePattern.MatchString(p.Name) {
+		return nil, fmt.Errorf("plugin name %q is not a safe sql identifier (must match %s)", p.Name, safePluginNamePattern.String())
+	}
+	table := "plugin_" + p.Name + "_kv"
+	_, _ = db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (key TEXT PRIMARY KEY, value TEXT)`, table))
+	return map[string]any{
+		"get": func(key string) (string, error) {
+			var value string
+			err := db.QueryRow(fmt.Sprintf(`SELECT value FROM %s WHERE key = ?`, table), key).Scan(&value)
+			if err == sql.ErrNoRows {
+				return "", nil
+			}
+			if err != nil {
+				return "", fmt.Errorf("sql.get: %w", err)
+			}
+			return value, nil
+		},
+		"set": func(key, value string) error {
+			_, err := db.Exec(fmt.Sprintf(`INSERT INTO %s (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value`, table), key, value)
+			if err != nil {
+				return fmt.Errorf("sql.set: %w", err)
+			}
+			return nil
+		},
+		"delete": func(key string) error {
+			_, err := db.Exec(fmt.Sprintf(`DELETE FROM %s WHERE key = ?`, table), key)
+			if err != nil {
+				return fmt.Errorf("sql.delete: %w", err)
+			}
+			return nil
+		},
+	}, nil
+}
+
+// FeatureManager / ApplicationCommands への登録コールバック
+func newBotBuiltin(m *Manager, p *Plugin) map[string]any {
+	return map[string]any{
+		"addFeature": func(name, idType string) error {
+			return m.host.AddFeature(name, idType, func(s *discordgo.Session, v *discordgo.MessageCreate) {
+				p.dispatch(s, func() {
+					if p.enabled && p.onMessage != nil {
+						arg := mapMessageCreate(p.vm, v)
+						p.vmCall(p.onMessage, arg)
+					}
+				})
+			})
+		},
+		"registerCommand": func(name string) {
+			m.host.ApplicationCommandRegister(name, func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+				p.dispatch(s, func() {
+					if p.enabled && p.onCommand != nil {
+						arg := mapInteractionCreate(p.vm, i)
+						p.vmCall(p.onCommand, arg)
+					}
+				})
+			})
+		},
+	}
+}
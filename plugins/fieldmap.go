@@ -0,0 +1,95 @@
+/*
+	Copyright (C) 2022-2023  ikafly144
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package plugins
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/dop251/goja"
+)
+
+// Go の discordgo 構造体を JS から触りやすいオブジェクトに変換する
+//
+// フィールド名は snake_case に変換し、IDは全て string として渡す
+func mapMessage(m *discordgo.Message) map[string]any {
+	if m == nil {
+		return nil
+	}
+	return map[string]any{
+		"id":         string(m.ID),
+		"channel_id": string(m.ChannelID),
+		"guild_id":   string(m.GuildID),
+		"content":    m.Content,
+		"author":     mapUser(m.Author),
+	}
+}
+
+func mapUser(u *discordgo.User) map[string]any {
+	if u == nil {
+		return nil
+	}
+	return map[string]any{
+		"id":       string(u.ID),
+		"username": u.Username,
+		"bot":      u.Bot,
+	}
+}
+
+func mapMember(mem *discordgo.Member) map[string]any {
+	if mem == nil {
+		return nil
+	}
+	roles := make([]string, len(mem.Roles))
+	copy(roles, mem.Roles)
+	return map[string]any{
+		"user":  mapUser(mem.User),
+		"roles": roles,
+		"nick":  mem.Nick,
+	}
+}
+
+// *discordgo.MessageCreate を onMessage(event) に渡す引数へ変換する
+func mapMessageCreate(vm *goja.Runtime, v *discordgo.MessageCreate) goja.Value {
+	return vm.ToValue(mapMessage(v.Message))
+}
+
+// *discordgo.InteractionCreate を onCommand/onInteraction の引数へ変換する
+func mapInteractionCreate(vm *goja.Runtime, i *discordgo.InteractionCreate) goja.Value {
+	var userID string
+	if i.Member != nil && i.Member.User != nil {
+		userID = string(i.Member.User.ID)
+	} else if i.User != nil {
+		userID = string(i.User.ID)
+	}
+	return vm.ToValue(map[string]any{
+		"id":         string(i.ID),
+		"channel_id": string(i.ChannelID),
+		"guild_id":   string(i.GuildID),
+		"user_id":    userID,
+		"custom_id":  customIDOf(i),
+	})
+}
+
+func customIDOf(i *discordgo.InteractionCreate) string {
+	switch i.Type {
+	case discordgo.InteractionMessageComponent:
+		return i.MessageComponentData().CustomID
+	case discordgo.InteractionModalSubmit:
+		return i.ModalSubmitData().CustomID
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,279 @@
+/*
+	Copyright (C) 2022-2023  ikafly144
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+// Package plugins は .js ファイルで書かれたプラグインを goja VM 上で実行するための仕組みを提供する
+package plugins
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dop251/goja"
+	"github.com/sabafly/gobot-lib/logging"
+)
+
+// プラグインの読み込み元になるホスト側の機能
+//
+// bot パッケージでは BotManager を包むアダプタ (pluginHost) がこれを満たす
+type Host interface {
+	AddFeature(name string, idType string, handler func(*discordgo.Session, *discordgo.MessageCreate)) error
+	ApplicationCommandRegister(name string, handler func(*discordgo.Session, *discordgo.InteractionCreate))
+}
+
+// プラグインのライフサイクル関数名
+const (
+	lifecycleInit       = "init"
+	lifecycleOnMessage  = "onMessage"
+	lifecycleOnCommand  = "onCommand"
+	lifecycleOnInteract = "onInteraction"
+)
+
+// 読み込み済みのプラグイン1つ分
+type Plugin struct {
+	Name    string
+	Path    string
+	vm      *goja.Runtime
+	enabled bool
+
+	// sql ビルトインが開いたコネクション。load/Reload で置き換わる際に閉じる
+	db *sql.DB
+
+	// goja.Runtime はゴルーチン間で共有できないため、vm に触れる入り口
+	// (init/onMessage/onCommand/onInteract) は必ずこれを取ってから呼ぶ。
+	// discordgo は各シャードのイベントを別々のゴルーチンで配送するので
+	// このロックなしでは同じ Runtime への呼び出しが衝突しうる
+	vmMu sync.Mutex
+
+	// dispatch 中のみ設定される。discord ビルトインはこれ越しに API を呼ぶ
+	// vmMu を取っている間だけ読み書きする
+	session *discordgo.Session
+
+	onMessage  goja.Callable
+	onCommand  goja.Callable
+	onInteract goja.Callable
+}
+
+// vm への呼び出しを1つずつに直列化しつつ、dispatch 中だけ session を差し込む
+func (p *Plugin) dispatch(s *discordgo.Session, fn func()) {
+	p.vmMu.Lock()
+	defer p.vmMu.Unlock()
+	p.session = s
+	fn()
+	p.session = nil
+}
+
+// goja の呼び出し結果のエラーをログに残すだけの薄いラッパー
+func (p *Plugin) vmCall(fn goja.Callable, args ...goja.Value) {
+	if _, err := fn(goja.Undefined(), args...); err != nil {
+		logging.Error("プラグイン %s のコールバックでエラー %s", p.Name, err)
+	}
+}
+
+// プラグインを管理する
+type Manager struct {
+	mu sync.RWMutex
+
+	host    Host
+	dir     string
+	plugins map[string]*Plugin
+
+	// プラグイン毎の fetch / sql の上限設定
+	fetchOpts FetchOptions
+	sqlOpen   SQLOpenFunc
+}
+
+// Manager の生成オプション
+type Option func(*Manager)
+
+// fetch ビルトインの許可リストとタイムアウトを設定する
+func WithFetchOptions(opts FetchOptions) Option {
+	return func(m *Manager) {
+		m.fetchOpts = opts
+	}
+}
+
+// sql ビルトインが使うコネクションの作り方を差し替える
+func WithSQLOpenFunc(f SQLOpenFunc) Option {
+	return func(m *Manager) {
+		m.sqlOpen = f
+	}
+}
+
+// BotManager からプラグインマネージャを作成する
+func NewManager(host Host, dir string, opts ...Option) *Manager {
+	m := &Manager{
+		host:      host,
+		dir:       dir,
+		plugins:   map[string]*Plugin{},
+		fetchOpts: DefaultFetchOptions(),
+		sqlOpen:   defaultSQLOpen,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// dir 直下の .js ファイルをすべて読み込む (サブディレクトリは辿らない)
+func (m *Manager) LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed read plugin dir: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".js") {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), ".js")
+		if err := m.load(name, filepath.Join(dir, e.Name())); err != nil {
+			logging.Error("プラグイン %s の読み込みに失敗 %s", name, err)
+			continue
+		}
+	}
+	return nil
+}
+
+// 単一のプラグインを読み直す
+func (m *Manager) Reload(name string) error {
+	m.mu.RLock()
+	p, ok := m.plugins[name]
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("error: unknown plugin %s", name)
+	}
+	return m.load(name, p.Path)
+}
+
+// プラグインの一覧を返す
+func (m *Manager) List() []*Plugin {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	plugins := make([]*Plugin, 0, len(m.plugins))
+	for _, p := range m.plugins {
+		plugins = append(plugins, p)
+	}
+	return plugins
+}
+
+// プラグインを無効にする
+func (m *Manager) Disable(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.plugins[name]
+	if !ok {
+		return fmt.Errorf("error: unknown plugin %s", name)
+	}
+	p.enabled = false
+	return nil
+}
+
+// プラグインを有効にする
+func (m *Manager) Enable(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.plugins[name]
+	if !ok {
+		return fmt.Errorf("error: unknown plugin %s", name)
+	}
+	p.enabled = true
+	return nil
+}
+
+func (m *Manager) load(name, path string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed read plugin file: %w", err)
+	}
+
+	vm := goja.New()
+	p := &Plugin{Name: name, Path: path, vm: vm, enabled: true}
+
+	if err := registerBuiltins(m, p); err != nil {
+		return fmt.Errorf("failed register builtins for %s: %w", name, err)
+	}
+
+	if _, err := vm.RunScript(name+".js", string(src)); err != nil {
+		return fmt.Errorf("failed run plugin %s: %w", name, err)
+	}
+
+	if fn, ok := goja.AssertFunction(vm.Get(lifecycleOnMessage)); ok {
+		p.onMessage = fn
+	}
+	if fn, ok := goja.AssertFunction(vm.Get(lifecycleOnCommand)); ok {
+		p.onCommand = fn
+	}
+	if fn, ok := goja.AssertFunction(vm.Get(lifecycleOnInteract)); ok {
+		p.onInteract = fn
+	}
+
+	if fn, ok := goja.AssertFunction(vm.Get(lifecycleInit)); ok {
+		var initErr error
+		p.dispatch(nil, func() {
+			if _, err := fn(goja.Undefined()); err != nil {
+				initErr = fmt.Errorf("plugin %s init() failed: %w", name, err)
+			}
+		})
+		if initErr != nil {
+			return initErr
+		}
+	}
+
+	m.mu.Lock()
+	old := m.plugins[name]
+	m.plugins[name] = p
+	m.mu.Unlock()
+
+	if old != nil && old.db != nil {
+		if err := old.db.Close(); err != nil {
+			logging.Error("プラグイン %s の旧コネクションのクローズに失敗 %s", name, err)
+		}
+	}
+	return nil
+}
+
+// MessageCreate イベントを有効な全プラグインに配送する
+func (m *Manager) DispatchMessage(s *discordgo.Session, v *discordgo.MessageCreate) {
+	for _, p := range m.List() {
+		if !p.enabled || p.onMessage == nil {
+			continue
+		}
+		p.dispatch(s, func() {
+			arg := mapMessageCreate(p.vm, v)
+			p.vmCall(p.onMessage, arg)
+		})
+	}
+}
+
+// コンポーネント/モーダルの InteractionCreate を有効な全プラグインに配送する
+//
+// ApplicationCommand は registerCommand/ApplicationCommandRegister 経由の
+// 専用ハンダラで配送されるため、ここでは onInteraction のみを対象にする
+func (m *Manager) DispatchInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	for _, p := range m.List() {
+		if !p.enabled || p.onInteract == nil {
+			continue
+		}
+		p.dispatch(s, func() {
+			arg := mapInteractionCreate(p.vm, i)
+			p.vmCall(p.onInteract, arg)
+		})
+	}
+}